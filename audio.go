@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// SampleFormat identifies the on-the-wire PCM sample encoding used to
+// modulate and demodulate tones, playing the same role Kirika's
+// audio.Source implementations play for their respective backends.
+type SampleFormat int
+
+const (
+	FormatInt8 SampleFormat = iota
+	FormatInt16
+	FormatInt32
+	FormatFloat32
+)
+
+func parseSampleFormat(s string) (SampleFormat, error) {
+	switch s {
+	case "int8":
+		return FormatInt8, nil
+	case "int16":
+		return FormatInt16, nil
+	case "int32":
+		return FormatInt32, nil
+	case "float32":
+		return FormatFloat32, nil
+	default:
+		return 0, fmt.Errorf("unknown sample format %q", s)
+	}
+}
+
+// BitDepth is the width of one sample of this format, in bits.
+func (f SampleFormat) BitDepth() int {
+	switch f {
+	case FormatInt8:
+		return 8
+	case FormatInt16:
+		return 16
+	default:
+		return 32
+	}
+}
+
+func (f SampleFormat) bytesPerSample() int {
+	return f.BitDepth() / 8
+}
+
+func (f SampleFormat) isFloat() bool {
+	return f == FormatFloat32
+}
+
+// Source generates a block of audio as normalized (roughly [-1, 1]) float32
+// samples, independent of how those samples will eventually be packed on
+// the wire.
+type Source interface {
+	Samples() []float32
+	SampleRate() int
+	BitDepth() int
+}
+
+// toneSource generates one windowed sinusoid at freq, `duration` seconds
+// long, at sampleRate.
+type toneSource struct {
+	freq       float64
+	sampleRate int
+	format     SampleFormat
+}
+
+func (t toneSource) Samples() []float32 {
+	numSamples := int(float64(t.sampleRate) * duration)
+	samples := make([]float32, numSamples)
+	for i := 0; i < numSamples; i++ {
+		time := float64(i) / float64(t.sampleRate)
+		window := 0.5 * (1 - math.Cos(2*math.Pi*float64(i)/float64(numSamples-1)))
+		samples[i] = float32(math.Sin(2*math.Pi*t.freq*time) * window)
+	}
+	return samples
+}
+
+func (t toneSource) SampleRate() int { return t.sampleRate }
+func (t toneSource) BitDepth() int   { return t.format.BitDepth() }
+
+// encodeSamples packs normalized float32 samples into the raw on-the-wire
+// bytes for format, using order for every multi-byte sample (order is
+// whatever the target container's spec requires - WAV is little-endian,
+// AU and this tool's FLAC and raw encodings are big-endian). int8 keeps
+// the original offset-binary storage (a bias of amplitude8Bit rather than
+// two's complement) and so isn't affected by order.
+func encodeSamples(samples []float32, format SampleFormat, order binary.ByteOrder) []byte {
+	buf := make([]byte, len(samples)*format.bytesPerSample())
+	for i, s := range samples {
+		switch format {
+		case FormatInt8:
+			v := int32(math.Round(float64(s) * amplitude8Bit))
+			buf[i] = byte(v + amplitude8Bit)
+		case FormatInt16:
+			v := int32(math.Round(float64(s) * amplitude16Bit))
+			order.PutUint16(buf[i*2:], uint16(int16(v)))
+		case FormatInt32:
+			v := int64(math.Round(float64(s) * amplitude32Bit))
+			order.PutUint32(buf[i*4:], uint32(int32(v)))
+		case FormatFloat32:
+			order.PutUint32(buf[i*4:], math.Float32bits(s))
+		}
+	}
+	return buf
+}
+
+// formatFromParams picks the SampleFormat a container's header describes.
+// Headerless containers (raw) report bitDepth 0, in which case the format
+// requested on the command line is used instead.
+func formatFromParams(params audioParams, fallback SampleFormat) SampleFormat {
+	switch {
+	case params.bitDepth == 0:
+		return fallback
+	case params.bitDepth == 8:
+		return FormatInt8
+	case params.bitDepth == 16:
+		return FormatInt16
+	case params.bitDepth == 32 && params.isFloat:
+		return FormatFloat32
+	case params.bitDepth == 32:
+		return FormatInt32
+	default:
+		return fallback
+	}
+}
+
+// decodeSamples is the inverse of encodeSamples.
+func decodeSamples(body []byte, format SampleFormat, order binary.ByteOrder) []float32 {
+	bps := format.bytesPerSample()
+	samples := make([]float32, len(body)/bps)
+	for i := range samples {
+		switch format {
+		case FormatInt8:
+			samples[i] = (float32(body[i*bps]) - amplitude8Bit) / amplitude8Bit
+		case FormatInt16:
+			v := int16(order.Uint16(body[i*bps:]))
+			samples[i] = float32(v) / amplitude16Bit
+		case FormatInt32:
+			v := int32(order.Uint32(body[i*bps:]))
+			samples[i] = float32(v) / amplitude32Bit
+		case FormatFloat32:
+			samples[i] = math.Float32frombits(order.Uint32(body[i*bps:]))
+		}
+	}
+	return samples
+}
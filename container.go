@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// audioParams describes the PCM format carried by a container, as recovered
+// from its header (or assumed, for headerless raw streams).
+type audioParams struct {
+	sampleRate int
+	bitDepth   int
+	channels   int
+	isFloat    bool
+}
+
+// container knows how to wrap raw PCM samples in a particular file format
+// and how to strip that format back off to recover the PCM parameters.
+type container interface {
+	WriteHeader(w io.Writer, sampleRate, bitDepth, channels int, isFloat bool) error
+	ReadHeader(r io.Reader) (audioParams, error)
+
+	// ByteOrder is the byte order multi-byte PCM samples are stored in for
+	// this container, per its spec (WAV is little-endian; everything else
+	// this tool writes is big-endian).
+	ByteOrder() binary.ByteOrder
+}
+
+func containerForFormat(format string) (container, error) {
+	switch format {
+	case "au":
+		return auContainer{}, nil
+	case "wav":
+		return wavContainer{}, nil
+	case "raw":
+		return rawContainer{}, nil
+	case "flac":
+		return flacContainer{}, nil
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+}
+
+// detectContainer sniffs the magic bytes at the start of input and returns
+// the container that can parse it, falling back to raw PCM when nothing
+// matches.
+func detectContainer(input []byte) container {
+	switch {
+	case len(input) >= 4 && string(input[0:4]) == ".snd":
+		return auContainer{}
+	case len(input) >= 4 && string(input[0:4]) == "RIFF":
+		return wavContainer{}
+	case len(input) >= 4 && string(input[0:4]) == "fLaC":
+		return flacContainer{}
+	default:
+		return rawContainer{}
+	}
+}
+
+// auContainer implements the Sun/NeXT .au format used by the original
+// encoder: a fixed 24-byte header followed by big-endian PCM.
+type auContainer struct{}
+
+func (auContainer) WriteHeader(w io.Writer, sampleRate, bitDepth, channels int, isFloat bool) error {
+	var encoding uint32
+	switch {
+	case isFloat && bitDepth == 32:
+		encoding = 6 // 32-bit IEEE float
+	case bitDepth == 8:
+		encoding = 2 // 8-bit linear
+	case bitDepth == 16:
+		encoding = 3 // 16-bit linear
+	case bitDepth == 32:
+		encoding = 5 // 32-bit linear
+	default:
+		return fmt.Errorf("au: unsupported bit depth %d", bitDepth)
+	}
+
+	header := make([]byte, 24)
+	copy(header[0:4], ".snd")
+	binary.BigEndian.PutUint32(header[4:8], 24)
+	binary.BigEndian.PutUint32(header[8:12], 0xffffffff)
+	binary.BigEndian.PutUint32(header[12:16], encoding)
+	binary.BigEndian.PutUint32(header[16:20], uint32(sampleRate))
+	binary.BigEndian.PutUint32(header[20:24], uint32(channels))
+	_, err := w.Write(header)
+	return err
+}
+
+func (auContainer) ReadHeader(r io.Reader) (audioParams, error) {
+	header := make([]byte, 24)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return audioParams{}, fmt.Errorf("au: reading header: %w", err)
+	}
+	if string(header[0:4]) != ".snd" {
+		return audioParams{}, fmt.Errorf("au: bad magic %q", header[0:4])
+	}
+
+	bitDepth, isFloat := 8, false
+	switch binary.BigEndian.Uint32(header[12:16]) {
+	case 3:
+		bitDepth = 16
+	case 5:
+		bitDepth = 32
+	case 6:
+		bitDepth, isFloat = 32, true
+	}
+
+	return audioParams{
+		sampleRate: int(binary.BigEndian.Uint32(header[16:20])),
+		bitDepth:   bitDepth,
+		channels:   int(binary.BigEndian.Uint32(header[20:24])),
+		isFloat:    isFloat,
+	}, nil
+}
+
+func (auContainer) ByteOrder() binary.ByteOrder { return binary.BigEndian }
+
+// wavContainer implements a minimal canonical PCM WAVE file: the three
+// mandatory chunks (RIFF, fmt , data) with no extension fields.
+type wavContainer struct{}
+
+func (wavContainer) WriteHeader(w io.Writer, sampleRate, bitDepth, channels int, isFloat bool) error {
+	blockAlign := channels * bitDepth / 8
+	byteRate := sampleRate * blockAlign
+	audioFormat := uint16(1) // PCM
+	if isFloat {
+		audioFormat = 3 // IEEE float
+	}
+
+	buf := make([]byte, 44)
+	copy(buf[0:4], "RIFF")
+	// dataSize is unknown up front (we're streaming to stdout), so we write
+	// 0xffffffff as a placeholder the way tools do for unseekable output.
+	binary.LittleEndian.PutUint32(buf[4:8], 0xffffffff)
+	copy(buf[8:12], "WAVE")
+	copy(buf[12:16], "fmt ")
+	binary.LittleEndian.PutUint32(buf[16:20], 16)
+	binary.LittleEndian.PutUint16(buf[20:22], audioFormat)
+	binary.LittleEndian.PutUint16(buf[22:24], uint16(channels))
+	binary.LittleEndian.PutUint32(buf[24:28], uint32(sampleRate))
+	binary.LittleEndian.PutUint32(buf[28:32], uint32(byteRate))
+	binary.LittleEndian.PutUint16(buf[32:34], uint16(blockAlign))
+	binary.LittleEndian.PutUint16(buf[34:36], uint16(bitDepth))
+	copy(buf[36:40], "data")
+	binary.LittleEndian.PutUint32(buf[40:44], 0xffffffff)
+
+	_, err := w.Write(buf)
+	return err
+}
+
+func (wavContainer) ReadHeader(r io.Reader) (audioParams, error) {
+	riff := make([]byte, 12)
+	if _, err := io.ReadFull(r, riff); err != nil {
+		return audioParams{}, fmt.Errorf("wav: reading RIFF chunk: %w", err)
+	}
+	if string(riff[0:4]) != "RIFF" || string(riff[8:12]) != "WAVE" {
+		return audioParams{}, fmt.Errorf("wav: not a RIFF/WAVE file")
+	}
+
+	var params audioParams
+	sawFmt := false
+	for {
+		id := make([]byte, 4)
+		if _, err := io.ReadFull(r, id); err != nil {
+			if sawFmt {
+				break
+			}
+			return audioParams{}, fmt.Errorf("wav: reading chunk id: %w", err)
+		}
+		size := make([]byte, 4)
+		if _, err := io.ReadFull(r, size); err != nil {
+			return audioParams{}, fmt.Errorf("wav: reading chunk size: %w", err)
+		}
+		chunkSize := binary.LittleEndian.Uint32(size)
+
+		if string(id) == "fmt " {
+			fmtBody := make([]byte, chunkSize)
+			if _, err := io.ReadFull(r, fmtBody); err != nil {
+				return audioParams{}, fmt.Errorf("wav: reading fmt chunk: %w", err)
+			}
+			params.channels = int(binary.LittleEndian.Uint16(fmtBody[2:4]))
+			params.sampleRate = int(binary.LittleEndian.Uint32(fmtBody[4:8]))
+			params.bitDepth = int(binary.LittleEndian.Uint16(fmtBody[14:16]))
+			params.isFloat = binary.LittleEndian.Uint16(fmtBody[0:2]) == 3
+			sawFmt = true
+			continue
+		}
+
+		if string(id) == "data" {
+			// Leave the reader positioned at the start of the PCM payload.
+			break
+		}
+
+		if _, err := io.CopyN(io.Discard, r, int64(chunkSize)); err != nil {
+			return audioParams{}, fmt.Errorf("wav: skipping %q chunk: %w", id, err)
+		}
+	}
+
+	if !sawFmt {
+		return audioParams{}, fmt.Errorf("wav: missing fmt chunk")
+	}
+	return params, nil
+}
+
+func (wavContainer) ByteOrder() binary.ByteOrder { return binary.LittleEndian }
+
+// rawContainer carries no header at all; the PCM parameters have to be
+// supplied out of band (flags), since there are no magic bytes to sniff.
+type rawContainer struct{}
+
+func (rawContainer) WriteHeader(w io.Writer, sampleRate, bitDepth, channels int, isFloat bool) error {
+	return nil
+}
+
+func (rawContainer) ReadHeader(r io.Reader) (audioParams, error) {
+	// No header to parse; bitDepth is left at 0 so the caller falls back to
+	// whatever sample format was requested via -sample on the command line.
+	return audioParams{sampleRate: sampleRate, bitDepth: 0, channels: 1}, nil
+}
+
+func (rawContainer) ByteOrder() binary.ByteOrder { return binary.BigEndian }
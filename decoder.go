@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+)
+
+// onsetHop is the short-time energy analysis window used to locate where
+// each symbol actually starts, rather than assuming samples line up with
+// fftSize-sized blocks from position 0.
+const onsetHop = 441
+
+// silenceThreshold separates "tone present" from "silence" in the average
+// per-sample energy of one onsetHop window. Tones are Hann-windowed, so
+// their energy ramps up gradually from true zero at a symbol's first
+// sample - the threshold has to sit close to that ramp's own floor, or
+// onset detection latches on several hops late and drifts the rest of the
+// stream's fixed-stride symbol boundaries along with it.
+const silenceThreshold = 1e-6
+
+// DecoderOptions configures a Decoder.
+type DecoderOptions struct {
+	Format SampleFormat
+	DTMF   bool
+
+	// SourceRate is the sample rate the input was actually recorded at,
+	// as recovered from a container header. If it differs from the
+	// internal sampleRate constant, the Decoder resamples before
+	// analysis so playback captured at e.g. 48000 Hz still decodes. Zero
+	// or equal to sampleRate means no resampling is needed.
+	SourceRate int
+
+	// ByteOrder is the byte order the source container's PCM samples are
+	// stored in. Nil defaults to binary.BigEndian, matching every
+	// container but WAV.
+	ByteOrder binary.ByteOrder
+}
+
+// Decoder streams PCM samples from an io.Reader and recovers the payload
+// bytes modulated onto them, doing its own symbol timing recovery instead
+// of assuming the input lines up perfectly with fftSize-sized blocks. That
+// makes it tolerant of leading silence and dropped samples ahead of a
+// block, at the cost of only being as precise as one onsetHop.
+type Decoder struct {
+	r         io.Reader
+	format    SampleFormat
+	dtmf      bool
+	byteOrder binary.ByteOrder
+
+	resampler *Resampler // nil if the source is already at sampleRate
+
+	leftover []byte    // undecoded tail bytes of a partial sample
+	samples  []float32 // buffered, not yet consumed samples, always at sampleRate
+	cursor   int       // index into samples of the next symbol search
+
+	synced bool // true once the first symbol's onset has been located
+
+	haveNibble bool
+	nibble     byte
+
+	pending []byte
+	eof     bool
+}
+
+// NewDecoder returns a Decoder that reads raw PCM samples (no container
+// header - callers strip that first) from r.
+func NewDecoder(r io.Reader, opts DecoderOptions) *Decoder {
+	order := opts.ByteOrder
+	if order == nil {
+		order = binary.BigEndian
+	}
+	d := &Decoder{r: r, format: opts.Format, dtmf: opts.DTMF, byteOrder: order}
+	if opts.SourceRate != 0 && opts.SourceRate != sampleRate {
+		d.resampler = NewResampler(opts.SourceRate, sampleRate)
+	}
+	return d
+}
+
+// ReadByte returns the next decoded payload byte, or io.EOF once the
+// stream is exhausted with nothing left to decode.
+func (d *Decoder) ReadByte() (byte, error) {
+	for len(d.pending) == 0 {
+		if err := d.decodeNext(); err != nil {
+			return 0, err
+		}
+	}
+	b := d.pending[0]
+	d.pending = d.pending[1:]
+	return b, nil
+}
+
+// Read implements io.Reader over the decoded payload.
+func (d *Decoder) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		b, err := d.ReadByte()
+		if err != nil {
+			if n > 0 {
+				return n, nil
+			}
+			return 0, err
+		}
+		p[n] = b
+		n++
+	}
+	return n, nil
+}
+
+// decodeNext locates and decodes the next symbol, appending any resulting
+// payload byte(s) to d.pending. It returns io.EOF only once the input is
+// exhausted and no further symbols can be found.
+func (d *Decoder) decodeNext() error {
+	// Once locked on, successive symbols are back to back (hex mode) or
+	// separated by a known gap (DTMF mode), so we trust the running
+	// cursor rather than re-searching every time - searching a
+	// Hann-windowed tone's near-zero edges tends to land a hop or two
+	// late and drift into the next symbol. A fresh search only happens
+	// up front (to skip leading silence) and again if a symbol fails to
+	// decode (to resynchronize after dropped samples).
+	want := fftSize + onsetHop
+	var onset int
+	for {
+		fillErr := d.fillSamples(want)
+
+		onset = d.cursor
+		if !d.synced {
+			onset = findOnset(d.samples, d.cursor)
+		}
+		if onset >= 0 && onset+fftSize <= len(d.samples) {
+			break
+		}
+		// Either genuinely out of signal, or the onset (or the full
+		// fftSize window past it) lies further into the stream than we
+		// asked fillSamples to buffer - e.g. past a stretch of leading
+		// or trailing silence longer than one lookahead. Only declare
+		// EOF once the underlying reader is actually exhausted; otherwise
+		// grow the request and search again instead of re-scanning the
+		// same buffer forever.
+		if fillErr != nil || d.eof {
+			return io.EOF
+		}
+		want += fftSize + onsetHop
+	}
+
+	window := d.samples[onset : onset+fftSize]
+
+	if d.dtmf {
+		low, high, ok := detectTwoFrequencies(window)
+		if !ok {
+			d.resync(onset)
+			return nil
+		}
+		d.synced = true
+		d.advance(onset + fftSize + int(float64(sampleRate)*dtmfGap))
+		d.pending = append(d.pending, byte(low<<4|high))
+		return nil
+	}
+
+	freq := detectFrequency(window)
+	digit := freqToHex(freq)
+	if digit == 255 {
+		d.resync(onset)
+		return nil
+	}
+	d.synced = true
+	d.advance(onset + fftSize)
+	if !d.haveNibble {
+		d.nibble, d.haveNibble = digit, true
+		return nil
+	}
+	pair := [2]byte{d.nibble, digit}
+	d.haveNibble = false
+	var b [1]byte
+	if _, err := hex.Decode(b[:], pair[:]); err == nil {
+		d.pending = append(d.pending, b[0])
+	}
+	return nil
+}
+
+// resync is called when the symbol at onset failed to decode, which means
+// we've lost alignment (e.g. from dropped samples). It drops synced so
+// the next call re-searches for an onset, starting one hop further along
+// so the same bad position isn't found again.
+func (d *Decoder) resync(onset int) {
+	d.synced = false
+	d.advance(onset + onsetHop)
+}
+
+// advance moves the cursor to newCursor and periodically drops already
+// consumed samples so the buffer doesn't grow for the life of the stream.
+func (d *Decoder) advance(newCursor int) {
+	d.cursor = newCursor
+	if d.cursor > 4*onsetHop*64 {
+		d.samples = append([]float32(nil), d.samples[d.cursor:]...)
+		d.cursor = 0
+	}
+}
+
+// fillSamples reads from the underlying reader until at least `want`
+// samples are buffered beyond the cursor, or the reader is exhausted.
+func (d *Decoder) fillSamples(want int) error {
+	bps := d.format.bytesPerSample()
+	for len(d.samples)-d.cursor < want {
+		if d.eof {
+			return io.EOF
+		}
+		buf := make([]byte, 4096)
+		n, err := d.r.Read(buf)
+		if n > 0 {
+			data := append(d.leftover, buf[:n]...)
+			usable := (len(data) / bps) * bps
+			decoded := decodeSamples(data[:usable], d.format, d.byteOrder)
+			if d.resampler != nil {
+				decoded = d.resampler.Process(decoded)
+			}
+			d.samples = append(d.samples, decoded...)
+			d.leftover = append([]byte(nil), data[usable:]...)
+		}
+		if err != nil {
+			d.eof = true
+			if d.resampler != nil {
+				d.samples = append(d.samples, d.resampler.Flush()...)
+			}
+			if len(d.samples)-d.cursor < want {
+				return io.EOF
+			}
+		}
+	}
+	return nil
+}
+
+// findOnset scans samples in onsetHop-sized hops, starting at from, for
+// the first hop whose average energy clears silenceThreshold. It returns
+// -1 if every remaining complete hop looks like silence.
+func findOnset(samples []float32, from int) int {
+	for i := from; i+onsetHop <= len(samples); i += onsetHop {
+		if hopEnergy(samples[i:i+onsetHop]) > silenceThreshold {
+			return i
+		}
+	}
+	return -1
+}
+
+func hopEnergy(hop []float32) float64 {
+	var sum float64
+	for _, s := range hop {
+		sum += float64(s) * float64(s)
+	}
+	return sum / float64(len(hop))
+}
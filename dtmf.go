@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"math/cmplx"
+	"sort"
+)
+
+// DTMF-style dual-tone mode: each symbol sums two simultaneous sinusoids,
+// one drawn from a "low" group and one from a "high" group of 16
+// frequencies each, giving 16*16 = 256 combinations - enough to carry one
+// full byte per symbol instead of one hex nibble. The two groups are kept
+// far apart (a guard band) so the FFT peak-picker in detectTwoFrequencies
+// can't confuse a low tone for a high one.
+const (
+	dtmfLowBase  = 600.0
+	dtmfHighBase = 2200.0
+	dtmfFreqStep = 40.0
+	dtmfGap      = 0.01 // seconds of silence inserted after each symbol
+)
+
+func dtmfLowFreq(i int) float64  { return dtmfLowBase + float64(i)*dtmfFreqStep }
+func dtmfHighFreq(i int) float64 { return dtmfHighBase + float64(i)*dtmfFreqStep }
+
+// dualToneSource generates the windowed sum of two sinusoids making up one
+// DTMF-style symbol.
+type dualToneSource struct {
+	fLow, fHigh float64
+	sampleRate  int
+	format      SampleFormat
+}
+
+func (d dualToneSource) Samples() []float32 {
+	numSamples := int(float64(d.sampleRate) * duration)
+	samples := make([]float32, numSamples)
+	for i := 0; i < numSamples; i++ {
+		t := float64(i) / float64(d.sampleRate)
+		window := 0.5 * (1 - math.Cos(2*math.Pi*float64(i)/float64(numSamples-1)))
+		v := 0.5*math.Sin(2*math.Pi*d.fLow*t) + 0.5*math.Sin(2*math.Pi*d.fHigh*t)
+		samples[i] = float32(v * window)
+	}
+	return samples
+}
+
+func (d dualToneSource) SampleRate() int { return d.sampleRate }
+func (d dualToneSource) BitDepth() int   { return d.format.BitDepth() }
+
+// generateDualToneBuffer encodes one symbol (fLow + fHigh) followed by a
+// short silence gap that lets the decoder find each symbol's onset.
+func generateDualToneBuffer(fLow, fHigh float64, format SampleFormat, order binary.ByteOrder) []byte {
+	src := dualToneSource{fLow: fLow, fHigh: fHigh, sampleRate: sampleRate, format: format}
+	tone := encodeSamples(src.Samples(), format, order)
+
+	gapSamples := int(float64(sampleRate) * dtmfGap)
+	gap := encodeSamples(make([]float32, gapSamples), format, order)
+
+	return append(tone, gap...)
+}
+
+// encodeDTMFBody encodes data as one dual-tone symbol per byte.
+func encodeDTMFBody(data []byte, format SampleFormat, order binary.ByteOrder) []byte {
+	var body []byte
+	for _, b := range data {
+		fLow := dtmfLowFreq(int(b >> 4))
+		fHigh := dtmfHighFreq(int(b & 0x0f))
+		body = append(body, generateDualToneBuffer(fLow, fHigh, format, order)...)
+	}
+	return body
+}
+
+// detectTwoFrequencies windows and FFTs samples, picks the two strongest
+// spectral peaks (each refined with parabolic interpolation), and maps
+// each peak independently to the nearest low/high group tone. ok is false
+// if the two peaks don't resolve to one low and one high tone.
+func detectTwoFrequencies(samples []float32) (lowIndex, highIndex int, ok bool) {
+	input := make([]complex128, fftSize)
+	for i := 0; i < len(samples); i++ {
+		window := 0.5 * (1 - math.Cos(2*math.Pi*float64(i)/float64(len(samples)-1)))
+		input[i] = complex(float64(samples[i])*window, 0)
+	}
+
+	output := fft(input)
+
+	type peak struct {
+		index     int
+		magnitude float64
+	}
+	var peaks []peak
+	for i := 1; i < fftSize/2-1; i++ {
+		magnitude := cmplx.Abs(output[i])
+		if magnitude > cmplx.Abs(output[i-1]) && magnitude > cmplx.Abs(output[i+1]) {
+			peaks = append(peaks, peak{i, magnitude})
+		}
+	}
+	if len(peaks) < 2 {
+		return 0, 0, false
+	}
+	sort.Slice(peaks, func(a, b int) bool { return peaks[a].magnitude > peaks[b].magnitude })
+
+	freqs := [2]float64{
+		interpolatedFreq(output, peaks[0].index),
+		interpolatedFreq(output, peaks[1].index),
+	}
+
+	var gotLow, gotHigh bool
+	for _, freq := range freqs {
+		li, lDist := nearestIndex(freq, dtmfLowBase)
+		hi, hDist := nearestIndex(freq, dtmfHighBase)
+		if lDist <= hDist {
+			lowIndex, gotLow = li, true
+		} else {
+			highIndex, gotHigh = hi, true
+		}
+	}
+
+	return lowIndex, highIndex, gotLow && gotHigh
+}
+
+func interpolatedFreq(output []complex128, index int) float64 {
+	if index <= 0 || index >= fftSize/2-1 {
+		return float64(index) * sampleRate / float64(fftSize)
+	}
+	alpha := cmplx.Abs(output[index-1])
+	beta := cmplx.Abs(output[index])
+	gamma := cmplx.Abs(output[index+1])
+	correction := 0.5 * (alpha - gamma) / (alpha - 2*beta + gamma)
+	return (float64(index) + correction) * sampleRate / float64(fftSize)
+}
+
+// nearestIndex finds the entry in a 16-tone group (base, base+step, ...,
+// base+15*step) closest to freq, returning its index and distance.
+func nearestIndex(freq, base float64) (index int, distance float64) {
+	index = int(math.Round((freq - base) / dtmfFreqStep))
+	if index < 0 {
+		index = 0
+	}
+	if index > 15 {
+		index = 15
+	}
+	distance = math.Abs(freq - (base + float64(index)*dtmfFreqStep))
+	return index, distance
+}
@@ -0,0 +1,371 @@
+// Package fec implements Reed-Solomon forward error correction over
+// GF(256), RS(255,223): 223 data bytes protected by 32 parity bytes,
+// correcting up to 16 byte errors per block. Encode wraps the payload
+// bytes before they are hex-encoded and modulated, and Decode unwraps them
+// (with correction) once decodeTones has demodulated the stream, so a
+// misread nibble is corrected instead of corrupting its byte.
+//
+// The field arithmetic and BM/Chien/Forney decoding below follow the
+// standard "Reed-Solomon codes for coders" construction; poly is
+// represented MSB-first, same convention that algorithm uses.
+package fec
+
+import "fmt"
+
+const (
+	paritySymbols  = 32
+	maxDataSymbols = 255 - paritySymbols // 223
+)
+
+// GF(2^8) with primitive polynomial x^8+x^4+x^3+x^2+1 (0x11d) and
+// generator element 2, the same field every common RS implementation
+// (QR codes, CDs, etc.) uses.
+var gfExp [512]byte
+var gfLog [256]byte
+
+// generator is the degree-paritySymbols generator polynomial used by
+// every encode/decode call. It depends on gfExp, so it's built in this
+// same init() rather than as a package-level var initializer - Go runs
+// var initializers before init() functions, which would otherwise leave
+// gfExp all zero when generatorPoly ran.
+var generator []byte
+
+func init() {
+	x := 1
+	for i := 0; i < 255; i++ {
+		gfExp[i] = byte(x)
+		gfLog[x] = byte(i)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11d
+		}
+	}
+	for i := 255; i < 512; i++ {
+		gfExp[i] = gfExp[i-255]
+	}
+
+	generator = generatorPoly(paritySymbols)
+}
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+func gfDiv(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return gfExp[(int(gfLog[a])+255-int(gfLog[b]))%255]
+}
+
+func gfPow(a byte, power int) byte {
+	if a == 0 {
+		if power == 0 {
+			return 1
+		}
+		return 0
+	}
+	e := ((int(gfLog[a])*power)%255 + 255) % 255
+	return gfExp[e]
+}
+
+func gfInverse(a byte) byte {
+	return gfExp[255-int(gfLog[a])]
+}
+
+// gfPolyScale multiplies every coefficient of p by x.
+func gfPolyScale(p []byte, x byte) []byte {
+	out := make([]byte, len(p))
+	for i, c := range p {
+		out[i] = gfMul(c, x)
+	}
+	return out
+}
+
+// gfPolyAdd XORs p and q, right-aligned (GF(2) subtraction is the same as
+// addition).
+func gfPolyAdd(p, q []byte) []byte {
+	n := len(p)
+	if len(q) > n {
+		n = len(q)
+	}
+	out := make([]byte, n)
+	copy(out[n-len(p):], p)
+	for i, c := range q {
+		out[n-len(q)+i] ^= c
+	}
+	return out
+}
+
+func gfPolyMul(p, q []byte) []byte {
+	out := make([]byte, len(p)+len(q)-1)
+	for i, pc := range p {
+		if pc == 0 {
+			continue
+		}
+		for j, qc := range q {
+			out[i+j] ^= gfMul(pc, qc)
+		}
+	}
+	return out
+}
+
+// gfPolyEval evaluates poly (MSB-first) at x via Horner's method.
+func gfPolyEval(poly []byte, x byte) byte {
+	var y byte
+	if len(poly) > 0 {
+		y = poly[0]
+	}
+	for i := 1; i < len(poly); i++ {
+		y = gfMul(y, x) ^ poly[i]
+	}
+	return y
+}
+
+// gfPolyDiv divides dividend by divisor (both MSB-first), returning the
+// quotient and remainder.
+func gfPolyDiv(dividend, divisor []byte) (quotient, remainder []byte) {
+	out := append([]byte(nil), dividend...)
+	for i := 0; i <= len(dividend)-len(divisor); i++ {
+		coef := out[i]
+		if coef == 0 {
+			continue
+		}
+		for j := 1; j < len(divisor); j++ {
+			if divisor[j] != 0 {
+				out[i+j] ^= gfMul(divisor[j], coef)
+			}
+		}
+	}
+	splitAt := len(out) - (len(divisor) - 1)
+	return out[:splitAt], out[splitAt:]
+}
+
+// generatorPoly returns g(x) = Prod_{i=0}^{nsym-1} (x - alpha^i).
+func generatorPoly(nsym int) []byte {
+	g := []byte{1}
+	for i := 0; i < nsym; i++ {
+		g = gfPolyMul(g, []byte{1, gfPow(2, i)})
+	}
+	return g
+}
+
+// encodeParity computes the paritySymbols parity bytes for data (at most
+// maxDataSymbols bytes) via polynomial synthetic division against
+// generator.
+func encodeParity(data []byte) []byte {
+	gen := generator
+	msgOut := make([]byte, len(data)+len(gen)-1)
+	copy(msgOut, data)
+	for i := 0; i < len(data); i++ {
+		coef := msgOut[i]
+		if coef == 0 {
+			continue
+		}
+		for j, gc := range gen {
+			msgOut[i+j] ^= gfMul(gc, coef)
+		}
+	}
+	return msgOut[len(data):]
+}
+
+// calcSyndromes evaluates block (data+parity, MSB-first) at alpha^i for i
+// in [0, nsym). All-zero syndromes mean no errors were detected.
+func calcSyndromes(block []byte, nsym int) []byte {
+	synd := make([]byte, nsym)
+	for i := 0; i < nsym; i++ {
+		synd[i] = gfPolyEval(block, gfPow(2, i))
+	}
+	return synd
+}
+
+// findErrorLocator runs Berlekamp-Massey over the syndromes to find the
+// error locator polynomial sigma(x).
+func findErrorLocator(synd []byte) ([]byte, error) {
+	errLoc := []byte{1}
+	oldLoc := []byte{1}
+
+	for i := 0; i < len(synd); i++ {
+		oldLoc = append(oldLoc, 0)
+
+		delta := synd[i]
+		for j := 1; j < len(errLoc); j++ {
+			delta ^= gfMul(errLoc[len(errLoc)-1-j], synd[i-j])
+		}
+
+		if delta == 0 {
+			continue
+		}
+		if len(oldLoc) > len(errLoc) {
+			newLoc := gfPolyScale(oldLoc, delta)
+			oldLoc = gfPolyScale(errLoc, gfInverse(delta))
+			errLoc = newLoc
+		}
+		errLoc = gfPolyAdd(errLoc, gfPolyScale(oldLoc, delta))
+	}
+
+	// Trim leading zero coefficients left over from the padding above.
+	i := 0
+	for i < len(errLoc) && errLoc[i] == 0 {
+		i++
+	}
+	errLoc = errLoc[i:]
+
+	errs := len(errLoc) - 1
+	if errs*2 > len(synd) {
+		return nil, fmt.Errorf("fec: too many errors to correct")
+	}
+	return errLoc, nil
+}
+
+// findErrorPositions runs a Chien search for the roots of errLoc and
+// converts each one to a position (from the start of block).
+//
+// errLoc's roots are alpha^-deg for each error's degree deg = blockLen-1-p
+// within block's polynomial. Searching alpha^i for i across the whole
+// field (not just [0, blockLen)) matters for a shortened code - a block
+// shorter than 255 bytes still uses exponents from the full GF(256), so a
+// root can land at an i whose corresponding degree only maps to a valid
+// position once the full field is considered.
+func findErrorPositions(errLoc []byte, blockLen int) ([]int, error) {
+	errs := len(errLoc) - 1
+	var pos []int
+	for i := 0; i < 255; i++ {
+		if gfPolyEval(errLoc, gfPow(2, i)) != 0 {
+			continue
+		}
+		deg := (255 - i) % 255
+		p := blockLen - 1 - deg
+		if p < 0 || p >= blockLen {
+			continue
+		}
+		pos = append(pos, p)
+	}
+	if len(pos) != errs {
+		return nil, fmt.Errorf("fec: error locator roots do not match error count, uncorrectable block")
+	}
+	return pos, nil
+}
+
+// correctErrors applies the Forney algorithm to compute each error's
+// magnitude and XORs it into block at the corresponding position.
+func correctErrors(block []byte, synd, errLoc []byte, errPos []int) ([]byte, error) {
+	coefPos := make([]int, len(errPos))
+	for i, p := range errPos {
+		coefPos[i] = len(block) - 1 - p
+	}
+
+	errEvalFull := gfPolyMul(reverse(synd), errLoc)
+	nsym := len(errLoc) - 1
+	_, errEval := gfPolyDiv(errEvalFull, append([]byte{1}, make([]byte, nsym+1)...))
+
+	out := append([]byte(nil), block...)
+	for i, p := range errPos {
+		xi := gfPow(2, coefPos[i]) // X_i = alpha^deg, the error locator value
+		xiInv := gfInverse(xi)
+
+		var errLocPrime byte = 1
+		for j := range coefPos {
+			if j == i {
+				continue
+			}
+			xj := gfPow(2, coefPos[j])
+			errLocPrime = gfMul(errLocPrime, gfAdd(1, gfMul(xiInv, xj)))
+		}
+		if errLocPrime == 0 {
+			return nil, fmt.Errorf("fec: Forney algorithm failed, uncorrectable block")
+		}
+
+		y := gfPolyEval(errEval, xiInv)
+		magnitude := gfDiv(y, errLocPrime)
+		out[p] ^= magnitude
+	}
+	return out, nil
+}
+
+func gfAdd(a, b byte) byte { return a ^ b }
+
+func reverse(p []byte) []byte {
+	out := make([]byte, len(p))
+	for i, c := range p {
+		out[len(p)-1-i] = c
+	}
+	return out
+}
+
+// correct corrects up to paritySymbols/2 byte errors in block (data
+// followed by paritySymbols parity bytes) and returns the first dataLen
+// corrected data bytes.
+func correct(block []byte, dataLen int) ([]byte, error) {
+	synd := calcSyndromes(block, paritySymbols)
+
+	hasErrors := false
+	for _, s := range synd {
+		if s != 0 {
+			hasErrors = true
+			break
+		}
+	}
+	if !hasErrors {
+		return block[:dataLen], nil
+	}
+
+	errLoc, err := findErrorLocator(synd)
+	if err != nil {
+		return nil, err
+	}
+	errPos, err := findErrorPositions(errLoc, len(block))
+	if err != nil {
+		return nil, err
+	}
+	corrected, err := correctErrors(block, synd, errLoc, errPos)
+	if err != nil {
+		return nil, err
+	}
+	return corrected[:dataLen], nil
+}
+
+// Encode splits data into maxDataSymbols-sized chunks and appends a
+// paritySymbols-byte Reed-Solomon parity block to each, prefixed with the
+// chunk's data length so Decode can split the stream back up (chunks
+// shorter than maxDataSymbols still use the full-size generator - a
+// shortened RS code - so the last, usually partial, chunk is encoded the
+// same way as a full one).
+func Encode(data []byte) []byte {
+	out := make([]byte, 0, len(data)+len(data)/maxDataSymbols*paritySymbols+paritySymbols)
+	for i := 0; i < len(data); i += maxDataSymbols {
+		end := i + maxDataSymbols
+		if end > len(data) {
+			end = len(data)
+		}
+		chunk := data[i:end]
+		out = append(out, byte(len(chunk)))
+		out = append(out, chunk...)
+		out = append(out, encodeParity(chunk)...)
+	}
+	return out
+}
+
+// Decode reverses Encode, correcting up to 16 byte errors in each chunk
+// along the way.
+func Decode(encoded []byte) ([]byte, error) {
+	var out []byte
+	for len(encoded) > 0 {
+		n := int(encoded[0])
+		encoded = encoded[1:]
+		total := n + paritySymbols
+		if len(encoded) < total {
+			return nil, fmt.Errorf("fec: truncated block")
+		}
+		corrected, err := correct(encoded[:total], n)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, corrected...)
+		encoded = encoded[total:]
+	}
+	return out, nil
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// flacContainer writes and reads a deliberately minimal FLAC stream: a
+// STREAMINFO block followed by a single frame holding one verbatim
+// (uncompressed) subframe. That's enough to make the tool's output a
+// spec-valid .flac file that any decoder can play, without pulling in a
+// real FLAC encoder for the steganographic payloads this tool deals with.
+// Only mono streams are supported, matching the rest of the tool.
+type flacContainer struct{}
+
+const flacBlockSize = 4096
+
+func (flacContainer) WriteHeader(w io.Writer, sampleRate, bitDepth, channels int, isFloat bool) error {
+	if channels != 1 {
+		return fmt.Errorf("flac: only mono output is supported, got %d channels", channels)
+	}
+	if isFloat {
+		return fmt.Errorf("flac: float samples are not supported by the FLAC format")
+	}
+
+	if _, err := w.Write([]byte("fLaC")); err != nil {
+		return err
+	}
+
+	streamInfo := make([]byte, 34)
+	binary.BigEndian.PutUint16(streamInfo[0:2], flacBlockSize)
+	binary.BigEndian.PutUint16(streamInfo[2:4], flacBlockSize)
+	// min/max frame size (bytes 4-9) left as 0: "unknown".
+	packed := uint64(sampleRate)<<44 | uint64(channels-1)<<41 | uint64(bitDepth-1)<<36
+	var rate [8]byte
+	binary.BigEndian.PutUint64(rate[:], packed)
+	copy(streamInfo[10:18], rate[:])
+	// total samples (low 36 bits of byte 13-17) and MD5 (18-33) left as 0:
+	// "unknown"/"not computed", both valid per the FLAC spec.
+
+	header := []byte{0x80, 0, 0, 34} // last-metadata-block flag set, type STREAMINFO
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(streamInfo)
+	return err
+}
+
+func (flacContainer) ReadHeader(r io.Reader) (audioParams, error) {
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return audioParams{}, fmt.Errorf("flac: reading magic: %w", err)
+	}
+	if string(magic) != "fLaC" {
+		return audioParams{}, fmt.Errorf("flac: bad magic %q", magic)
+	}
+
+	blockHeader := make([]byte, 4)
+	if _, err := io.ReadFull(r, blockHeader); err != nil {
+		return audioParams{}, fmt.Errorf("flac: reading metadata block header: %w", err)
+	}
+	if blockHeader[0]&0x7f != 0 {
+		return audioParams{}, fmt.Errorf("flac: expected STREAMINFO as the first metadata block")
+	}
+	blockLen := int(blockHeader[1])<<16 | int(blockHeader[2])<<8 | int(blockHeader[3])
+	streamInfo := make([]byte, blockLen)
+	if _, err := io.ReadFull(r, streamInfo); err != nil {
+		return audioParams{}, fmt.Errorf("flac: reading STREAMINFO: %w", err)
+	}
+
+	var rate [8]byte
+	copy(rate[:], streamInfo[10:18])
+	packed := binary.BigEndian.Uint64(rate[:])
+	params := audioParams{
+		sampleRate: int(packed >> 44),
+		channels:   int((packed>>41)&0x7) + 1,
+		bitDepth:   int((packed>>36)&0x1f) + 1,
+	}
+
+	// Skip any remaining (non-last) metadata blocks to leave r positioned
+	// at the first frame.
+	last := blockHeader[0]&0x80 != 0
+	for !last {
+		if _, err := io.ReadFull(r, blockHeader); err != nil {
+			return audioParams{}, fmt.Errorf("flac: reading metadata block header: %w", err)
+		}
+		last = blockHeader[0]&0x80 != 0
+		blockLen = int(blockHeader[1])<<16 | int(blockHeader[2])<<8 | int(blockHeader[3])
+		if _, err := io.CopyN(io.Discard, r, int64(blockLen)); err != nil {
+			return audioParams{}, fmt.Errorf("flac: skipping metadata block: %w", err)
+		}
+	}
+
+	return params, nil
+}
+
+// ByteOrder is big-endian, matching the convention encodeTones/decodeTones
+// use for the intermediate PCM buffer passed to flacWriteFrames/returned by
+// flacReadFrames - FLAC's bitstream has no byte-level sample endianness of
+// its own, so this is this tool's own choice, not a spec requirement.
+func (flacContainer) ByteOrder() binary.ByteOrder { return binary.BigEndian }
+
+// flacWriteFrames splits pcm (raw big-endian samples, as produced elsewhere
+// in this package) into flacBlockSize-sample blocks and writes one
+// verbatim-subframe FLAC frame per block. A single frame is limited to
+// 65536 samples by its 16-bit block-size field, so anything longer than
+// one block has to be split up front.
+func flacWriteFrames(w io.Writer, pcm []byte, bitDepth int) error {
+	bytesPerSample := bitDepth / 8
+	blockBytes := flacBlockSize * bytesPerSample
+
+	frameNumber := 0
+	for offset := 0; offset < len(pcm); offset += blockBytes {
+		end := offset + blockBytes
+		if end > len(pcm) {
+			end = len(pcm)
+		}
+		if err := flacWriteFrame(w, frameNumber, pcm[offset:end], bitDepth); err != nil {
+			return err
+		}
+		frameNumber++
+	}
+	return nil
+}
+
+// flacWriteFrame writes a single verbatim-subframe FLAC frame for one block
+// of pcm. Only the low 8 bits of frameNumber are written, so frame numbers
+// wrap after 256 frames (about 59 payload bytes in hex mode);
+// flacReadFrame does not check the field.
+func flacWriteFrame(w io.Writer, frameNumber int, pcm []byte, bitDepth int) error {
+	bytesPerSample := bitDepth / 8
+	numSamples := len(pcm) / bytesPerSample
+
+	bw := newBitWriter()
+	bw.writeBits(0x3ffe, 14) // sync code
+	bw.writeBits(0, 1)       // reserved
+	bw.writeBits(0, 1)       // fixed-blocksize strategy
+	bw.writeBits(0x7, 4)     // block size: read from the 16-bit field below
+	bw.writeBits(0, 4)       // sample rate: unknown, read from STREAMINFO
+	bw.writeBits(0, 4)       // channel assignment: mono
+	bw.writeBits(0, 3)       // sample size: unknown, read from STREAMINFO
+	bw.writeBits(0, 1)       // reserved
+	bw.writeBits(uint64(frameNumber), 8)
+	bw.writeBits(uint64(numSamples-1), 16)
+
+	headerBytes := bw.bytes()
+	headerBytes = append(headerBytes, crc8(headerBytes))
+
+	sw := newBitWriter()
+	sw.writeBits(0, 1) // subframe "zero" bit
+	sw.writeBits(1, 6) // verbatim subframe type
+	sw.writeBits(0, 1) // no wasted bits
+
+	for i := 0; i < numSamples; i++ {
+		var sample int64
+		if bitDepth == 16 {
+			sample = int64(int16(binary.BigEndian.Uint16(pcm[i*2:])))
+		} else {
+			sample = int64(pcm[i]) - amplitude8Bit
+		}
+		sw.writeBits(uint64(uint32(sample))&((1<<uint(bitDepth))-1), bitDepth)
+	}
+
+	frame := append(headerBytes, sw.bytes()...)
+	frame = append(frame, crc16(frame)...)
+
+	_, err := w.Write(frame)
+	return err
+}
+
+// flacReadFrames reads the sequence of frames written by flacWriteFrames
+// and returns their concatenated PCM payload.
+func flacReadFrames(r io.Reader, bitDepth int) ([]byte, error) {
+	var pcm []byte
+	for {
+		block, err := flacReadFrame(r, bitDepth)
+		if err == io.EOF {
+			return pcm, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		pcm = append(pcm, block...)
+	}
+}
+
+// flacReadFrame reads one verbatim-subframe FLAC frame written by
+// flacWriteFrame and returns its raw PCM payload.
+func flacReadFrame(r io.Reader, bitDepth int) ([]byte, error) {
+	br := newBitReader(r)
+
+	sync, err := br.readBits(14)
+	if err != nil {
+		return nil, io.EOF
+	}
+	if sync != 0x3ffe {
+		return nil, fmt.Errorf("flac: bad frame sync code")
+	}
+	if _, err := br.readBits(2); err != nil {
+		return nil, err
+	}
+	if _, err := br.readBits(4); err != nil {
+		return nil, err
+	}
+	if _, err := br.readBits(4); err != nil {
+		return nil, err
+	}
+	if _, err := br.readBits(4); err != nil {
+		return nil, err
+	}
+	if _, err := br.readBits(3); err != nil {
+		return nil, err
+	}
+	if _, err := br.readBits(1); err != nil {
+		return nil, err
+	}
+	if _, err := br.readBits(8); err != nil { // frame number
+		return nil, err
+	}
+	blockSizeField, err := br.readBits(16)
+	if err != nil {
+		return nil, err
+	}
+	numSamples := int(blockSizeField) + 1
+
+	if _, err := br.readBits(8); err != nil { // frame header CRC-8
+		return nil, err
+	}
+
+	if _, err := br.readBits(1); err != nil { // subframe "zero" bit
+		return nil, err
+	}
+	if _, err := br.readBits(6); err != nil { // subframe type
+		return nil, err
+	}
+	if _, err := br.readBits(1); err != nil { // wasted-bits flag
+		return nil, err
+	}
+
+	bytesPerSample := bitDepth / 8
+	pcm := make([]byte, numSamples*bytesPerSample)
+	for i := 0; i < numSamples; i++ {
+		bits, err := br.readBits(bitDepth)
+		if err != nil {
+			return nil, err
+		}
+		sample := signExtend(bits, bitDepth)
+		if bitDepth == 16 {
+			binary.BigEndian.PutUint16(pcm[i*2:], uint16(sample))
+		} else {
+			pcm[i] = byte(sample + amplitude8Bit)
+		}
+	}
+
+	if _, err := br.readBits(16); err != nil { // frame footer CRC-16
+		return nil, err
+	}
+
+	return pcm, nil
+}
+
+func signExtend(bits uint64, width int) int64 {
+	shift := 64 - uint(width)
+	return int64(bits<<shift) >> shift
+}
+
+// bitWriter accumulates bits MSB-first into a byte slice, matching FLAC's
+// bitstream convention.
+type bitWriter struct {
+	buf   []byte
+	cur   byte
+	nbits uint
+}
+
+func newBitWriter() *bitWriter { return &bitWriter{} }
+
+func (b *bitWriter) writeBits(v uint64, n int) {
+	for i := n - 1; i >= 0; i-- {
+		bit := byte((v >> uint(i)) & 1)
+		b.cur = b.cur<<1 | bit
+		b.nbits++
+		if b.nbits == 8 {
+			b.buf = append(b.buf, b.cur)
+			b.cur, b.nbits = 0, 0
+		}
+	}
+}
+
+// bytes flushes any partial trailing byte (zero-padded) and returns the
+// accumulated buffer.
+func (b *bitWriter) bytes() []byte {
+	for b.nbits != 0 {
+		b.writeBits(0, 1)
+	}
+	return b.buf
+}
+
+// bitReader reads MSB-first bits off an io.Reader, matching FLAC's
+// bitstream convention.
+type bitReader struct {
+	r     io.ByteReader
+	cur   byte
+	nbits uint
+}
+
+func newBitReader(r io.Reader) *bitReader {
+	if br, ok := r.(io.ByteReader); ok {
+		return &bitReader{r: br}
+	}
+	return &bitReader{r: &byteReaderAdapter{r}}
+}
+
+func (b *bitReader) readBits(n int) (uint64, error) {
+	var v uint64
+	for i := 0; i < n; i++ {
+		if b.nbits == 0 {
+			c, err := b.r.ReadByte()
+			if err != nil {
+				return 0, err
+			}
+			b.cur = c
+			b.nbits = 8
+		}
+		bit := (b.cur >> 7) & 1
+		b.cur <<= 1
+		b.nbits--
+		v = v<<1 | uint64(bit)
+	}
+	return v, nil
+}
+
+// byteReaderAdapter gives an io.Reader without native ReadByte support a
+// one-byte-at-a-time ReadByte method.
+type byteReaderAdapter struct {
+	r io.Reader
+}
+
+func (a *byteReaderAdapter) ReadByte() (byte, error) {
+	var buf [1]byte
+	if _, err := io.ReadFull(a.r, buf[:]); err != nil {
+		return 0, err
+	}
+	return buf[0], nil
+}
+
+func crc8(data []byte) byte {
+	var crc byte
+	for _, b := range data {
+		crc ^= b
+		for i := 0; i < 8; i++ {
+			if crc&0x80 != 0 {
+				crc = crc<<1 ^ 0x07
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+func crc16(data []byte) []byte {
+	var crc uint16
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x8005
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	out := make([]byte, 2)
+	binary.BigEndian.PutUint16(out, crc)
+	return out
+}
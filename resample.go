@@ -0,0 +1,107 @@
+package main
+
+import "math"
+
+// resamplerTaps sets the half-width, in source samples, of the
+// windowed-sinc kernel used to interpolate between samples. Wider
+// captures more of the sinc's energy at the cost of more multiply-adds
+// per output sample.
+const resamplerTaps = 8
+
+// Resampler streams samples at srcRate through a windowed-sinc
+// interpolator to produce samples at dstRate, the way ebiten's
+// convert.NewResampling lets playback code work at one internal rate
+// regardless of the source's actual rate (e.g. a 48kHz recording decoded
+// against this tool's 44100Hz analysis rate). It's incremental - Process
+// can be called repeatedly as more source samples arrive, carrying just
+// enough trailing history between calls to interpolate across the
+// boundary without discontinuities.
+type Resampler struct {
+	srcRate, dstRate int
+	history          []float32 // tail of previously seen input, kept for the next call's kernel
+	pos              float64   // next output sample's position, in source-sample units relative to history[0]
+}
+
+// NewResampler returns a Resampler converting from srcRate to dstRate.
+func NewResampler(srcRate, dstRate int) *Resampler {
+	return &Resampler{srcRate: srcRate, dstRate: dstRate}
+}
+
+// Process resamples in - taken to immediately follow whatever was passed
+// to the previous call - and returns as many dstRate samples as can be
+// produced without needing source samples beyond what's been supplied so
+// far. Call it again with the next chunk to get the rest.
+func (r *Resampler) Process(in []float32) []float32 {
+	if r.srcRate == r.dstRate {
+		return in
+	}
+
+	buf := append(r.history, in...)
+
+	step := float64(r.srcRate) / float64(r.dstRate)
+	var out []float32
+	for r.pos+resamplerTaps < float64(len(buf)) {
+		out = append(out, sincInterpolate(buf, r.pos))
+		r.pos += step
+	}
+
+	// Keep enough trailing history for the next call's kernel to reach
+	// back into, and rebase pos relative to the new history slice.
+	keepFrom := int(r.pos) - resamplerTaps
+	if keepFrom < 0 {
+		keepFrom = 0
+	}
+	r.pos -= float64(keepFrom)
+	r.history = append([]float32(nil), buf[keepFrom:]...)
+
+	return out
+}
+
+// Flush returns the trailing output samples that Process withheld because
+// producing them required source samples beyond what had arrived yet. Call
+// it once, after the last Process call, when the source is known to be
+// exhausted - the kernel falls back to whatever history remains (treating
+// everything past it as silence) rather than waiting forever for samples
+// that will never come.
+func (r *Resampler) Flush() []float32 {
+	if r.srcRate == r.dstRate || len(r.history) == 0 {
+		return nil
+	}
+
+	step := float64(r.srcRate) / float64(r.dstRate)
+	var out []float32
+	for r.pos < float64(len(r.history))+resamplerTaps {
+		out = append(out, sincInterpolate(r.history, r.pos))
+		r.pos += step
+	}
+	r.history = nil
+	return out
+}
+
+// sincInterpolate estimates buf's value at the (generally fractional)
+// position pos from the resamplerTaps nearest samples on either side.
+func sincInterpolate(buf []float32, pos float64) float32 {
+	center := int(math.Floor(pos))
+	var sum float64
+	for tap := center - resamplerTaps; tap <= center+resamplerTaps; tap++ {
+		if tap < 0 || tap >= len(buf) {
+			continue
+		}
+		sum += float64(buf[tap]) * windowedSinc(pos-float64(tap))
+	}
+	return float32(sum)
+}
+
+// windowedSinc is sinc(x) tapered by a Hann window over [-resamplerTaps,
+// resamplerTaps], zero outside it.
+func windowedSinc(x float64) float64 {
+	if x <= -resamplerTaps || x >= resamplerTaps {
+		return 0
+	}
+	if x == 0 {
+		return 1
+	}
+	sinc := math.Sin(math.Pi*x) / (math.Pi * x)
+	window := 0.5 * (1 + math.Cos(math.Pi*x/resamplerTaps))
+	return sinc * window
+}